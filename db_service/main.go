@@ -7,9 +7,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/jackc/pgx/v5"
+	"github.com/lib/pq"
 )
 
 type Summoner struct {
@@ -18,9 +21,65 @@ type Summoner struct {
 	Tagline  string `json:"summoner_tagline"`
 }
 
+// VoiceProfile holds a guild's TTS preferences, e.g. voices.German plus
+// speed/pitch tweaks applied by the TTS service's ffmpeg filters.
+type VoiceProfile struct {
+	GuildID  string  `json:"guild_id"`
+	Voice    string  `json:"voice"`
+	Language string  `json:"language"`
+	Speed    float64 `json:"speed"`
+	Pitch    float64 `json:"pitch"`
+}
+
+// PartyRequest describes a "watch party" grouping: the set of guilds whose
+// voice channels should play a zinger in lockstep.
+type PartyRequest struct {
+	PartyID  string   `json:"party_id"`
+	GuildIDs []string `json:"guild_ids"`
+}
+
 var db *pgx.Conn
 var rdb *redis.Client
 
+// summonerWatchHub fans out rows delivered over the summoner_change LISTEN
+// channel to every connected /watch_summoners subscriber, not just one.
+type summonerWatchHub struct {
+	mu   sync.Mutex
+	subs map[chan Summoner]struct{}
+}
+
+var summonerWatchers = &summonerWatchHub{subs: make(map[chan Summoner]struct{})}
+
+// subscribe registers a new watcher channel; callers must unsubscribe when done.
+func (h *summonerWatchHub) subscribe() chan Summoner {
+	ch := make(chan Summoner, 16)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *summonerWatchHub) unsubscribe(ch chan Summoner) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+	close(ch)
+}
+
+// broadcast delivers a notification to every subscriber, dropping it for
+// any watcher whose buffer is full rather than blocking the LISTEN loop.
+func (h *summonerWatchHub) broadcast(summoner Summoner) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- summoner:
+		default:
+			log.Printf("Dropping summoner_change notification, a watcher isn't keeping up")
+		}
+	}
+}
+
 func init() {
 	var err error
 	db, err = pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
@@ -47,6 +106,44 @@ func init() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	_, err = db.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS voice_profiles (guildid VARCHAR(255) PRIMARY KEY, voice VARCHAR(255), language VARCHAR(255), speed REAL, pitch REAL)")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = db.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS party_members (party_id VARCHAR(255), guild_id VARCHAR(255), PRIMARY KEY (party_id, guild_id))")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// json_build_object keys are aliased to match the Summoner struct's JSON
+	// tags (summoner_name/summoner_guild_id/summoner_tagline) -- row_to_json
+	// would instead emit the raw column names (name/guildid/tagline) and
+	// every field would come back empty on the watch_summoners side.
+	_, err = db.Exec(context.Background(), `CREATE OR REPLACE FUNCTION notify_summoner_change() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		PERFORM pg_notify('summoner_change', json_build_object('summoner_name', OLD.name, 'summoner_guild_id', OLD.guildid, 'summoner_tagline', OLD.tagline)::text);
+		RETURN OLD;
+	END IF;
+	PERFORM pg_notify('summoner_change', json_build_object('summoner_name', NEW.name, 'summoner_guild_id', NEW.guildid, 'summoner_tagline', NEW.tagline)::text);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = db.Exec(context.Background(), `DROP TRIGGER IF EXISTS summoners_notify_change ON summoners`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = db.Exec(context.Background(), `CREATE TRIGGER summoners_notify_change
+	AFTER INSERT OR UPDATE OR DELETE ON summoners
+	FOR EACH ROW EXECUTE FUNCTION notify_summoner_change()`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go listenForSummonerChanges(os.Getenv("DATABASE_URL"))
 }
 
 func main() {
@@ -54,9 +151,81 @@ func main() {
 	http.HandleFunc("POST /add_summoner", add_summoner)
 	http.HandleFunc("GET /get_summoners", get_summoners)
 	http.HandleFunc("POST /update_summoner", update_summoner)
+	http.HandleFunc("GET /watch_summoners", watch_summoners)
+	http.HandleFunc("GET /guild/{id}/voice", get_voice_profile)
+	http.HandleFunc("PUT /guild/{id}/voice", put_voice_profile)
+	http.HandleFunc("POST /party", create_party)
+	http.HandleFunc("GET /party/{guildId}", get_party)
 	log.Fatal(http.ListenAndServe(":8000", nil))
 }
 
+// listenForSummonerChanges holds a pq.Listener on the summoner_change
+// channel so that every replica of this service, not just the one that
+// handled the mutation, invalidates its Redis cache and can push updates
+// to subscribers of /watch_summoners.
+func listenForSummonerChanges(dbUrl string) {
+	listener := pq.NewListener(dbUrl, 10*time.Millisecond, time.Hour, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("summoner_change listener event error: %v", err)
+		}
+	})
+	if err := listener.Listen("summoner_change"); err != nil {
+		log.Printf("Error listening on summoner_change: %v", err)
+		return
+	}
+
+	for notification := range listener.Notify {
+		if notification == nil {
+			continue
+		}
+		invalidateCache()
+
+		var summoner Summoner
+		if err := json.Unmarshal([]byte(notification.Extra), &summoner); err != nil {
+			log.Printf("Error unmarshaling summoner_change payload: %v", err)
+			continue
+		}
+
+		summonerWatchers.broadcast(summoner)
+	}
+}
+
+// watch_summoners streams summoner_change notifications to the caller as
+// Server-Sent Events, letting external services react without polling.
+func watch_summoners(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	log.Printf("Received watch_summoners request from %s", r.RemoteAddr)
+
+	sub := summonerWatchers.subscribe()
+	defer summonerWatchers.unsubscribe(sub)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case summoner := <-sub:
+			data, err := json.Marshal(summoner)
+			if err != nil {
+				log.Printf("Error marshaling summoner for watch_summoners: %v", err)
+				continue
+			}
+			if _, err := w.Write([]byte("data: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
 func invalidateCache() {
 	err := rdb.Del(context.Background(), "summoners_cache").Err()
 	if err != nil {
@@ -147,3 +316,133 @@ func update_summoner(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
+
+func get_voice_profile(w http.ResponseWriter, r *http.Request) {
+	guildID := r.PathValue("id")
+	log.Printf("Received get_voice_profile request for guild %s", guildID)
+
+	profile := VoiceProfile{GuildID: guildID}
+	err := db.QueryRow(context.Background(), "SELECT voice, language, speed, pitch FROM voice_profiles WHERE guildid = $1", guildID).
+		Scan(&profile.Voice, &profile.Language, &profile.Speed, &profile.Pitch)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "No voice profile for guild", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error querying voice profile for guild %s: %v", guildID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(profile)
+}
+
+func put_voice_profile(w http.ResponseWriter, r *http.Request) {
+	guildID := r.PathValue("id")
+	log.Printf("Received put_voice_profile request for guild %s", guildID)
+
+	profile := VoiceProfile{}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	err = json.Unmarshal(body, &profile)
+	if err != nil {
+		log.Printf("Error unmarshaling JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	_, err = db.Exec(context.Background(), `INSERT INTO voice_profiles (guildid, voice, language, speed, pitch) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (guildid) DO UPDATE SET voice = $2, language = $3, speed = $4, pitch = $5`,
+		guildID, profile.Voice, profile.Language, profile.Speed, profile.Pitch)
+	if err != nil {
+		log.Printf("Error upserting voice profile for guild %s: %v", guildID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Successfully set voice profile for guild %s", guildID)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// create_party persists (replacing any prior membership) the set of guilds
+// that should play zingers in lockstep for a given party_id.
+func create_party(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received create_party request from %s", r.RemoteAddr)
+	party := PartyRequest{}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	err = json.Unmarshal(body, &party)
+	if err != nil {
+		log.Printf("Error unmarshaling JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	_, err = db.Exec(context.Background(), "DELETE FROM party_members WHERE party_id = $1", party.PartyID)
+	if err != nil {
+		log.Printf("Error clearing party %s: %v", party.PartyID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, guildID := range party.GuildIDs {
+		_, err = db.Exec(context.Background(), "INSERT INTO party_members (party_id, guild_id) VALUES ($1, $2)", party.PartyID, guildID)
+		if err != nil {
+			log.Printf("Error adding guild %s to party %s: %v", guildID, party.PartyID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	log.Printf("Successfully created party %s with %d guilds", party.PartyID, len(party.GuildIDs))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// get_party returns every guild grouped into the same party as guildId, so
+// the TTS service knows who else to fan a zinger's playback out to.
+func get_party(w http.ResponseWriter, r *http.Request) {
+	guildID := r.PathValue("guildId")
+	log.Printf("Received get_party request for guild %s", guildID)
+
+	var partyID string
+	err := db.QueryRow(context.Background(), "SELECT party_id FROM party_members WHERE guild_id = $1", guildID).Scan(&partyID)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Guild is not in a party", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error querying party for guild %s: %v", guildID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query(context.Background(), "SELECT guild_id FROM party_members WHERE party_id = $1", partyID)
+	if err != nil {
+		log.Printf("Error querying party members for party %s: %v", partyID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	guildIDs := []string{}
+	for rows.Next() {
+		var memberGuildID string
+		if err := rows.Scan(&memberGuildID); err != nil {
+			log.Printf("Error scanning party member row: %v", err)
+			continue
+		}
+		guildIDs = append(guildIDs, memberGuildID)
+	}
+
+	json.NewEncoder(w).Encode(PartyRequest{PartyID: partyID, GuildIDs: guildIDs})
+}
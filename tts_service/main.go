@@ -1,14 +1,30 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
 	// htgo-tts
 	htgotts "github.com/hegedustibor/htgo-tts"
 	handlers "github.com/hegedustibor/htgo-tts/handlers"
@@ -18,14 +34,240 @@ import (
 )
 
 type ZingerMessage struct {
-	Text    string `json:"zinger"`
-	GuildID string `json:"guild_id"`
+	Text     string `json:"zinger"`
+	GuildID  string `json:"guild_id"`
+	Voice    string `json:"voice"`
+	Language string `json:"language"`
+	SSML     bool   `json:"ssml"`
+}
+
+// VoiceProfile mirrors the db service's per-guild TTS preferences, hydrated
+// at consume time (with a Redis cache) and merged onto the ZingerMessage.
+type VoiceProfile struct {
+	GuildID  string  `json:"guild_id"`
+	Voice    string  `json:"voice"`
+	Language string  `json:"language"`
+	Speed    float64 `json:"speed"`
+	Pitch    float64 `json:"pitch"`
 }
 
 type AudioMessage struct {
-	Filename string `json:"filename"`
-	Path     string `json:"path"`
-	GuildID  string `json:"guild_id"`
+	Filename string    `json:"filename"`
+	Path     string    `json:"path"`
+	GuildID  string    `json:"guild_id"`
+	PlayAt   time.Time `json:"play_at,omitempty"`
+}
+
+// PartyMembership mirrors the database service's /party response: every
+// guild in the party, the zinger's own GuildID included, that should play
+// it in lockstep.
+type PartyMembership struct {
+	PartyID  string   `json:"party_id"`
+	GuildIDs []string `json:"guild_ids"`
+}
+
+const audioBroadcastExchange = "audio.broadcast"
+
+// partyPlaybackDelay gives downstream playback workers enough time to
+// receive the broadcast, buffer the file, and sleep until PlayAt in lockstep.
+const partyPlaybackDelay = 2 * time.Second
+
+const (
+	zingersDLX     = "zingers.dlx"
+	zingersDead    = "zingers.dead"
+	maxRetries     = 3
+	retryReasonHdr = "x-retry-reason"
+)
+
+// retryStages are the escalating backoff queues a failed zinger cycles
+// through before landing in zingers.dead. Each queue TTLs its messages back
+// onto the zingers queue via its own x-dead-letter-exchange.
+var retryStages = []struct {
+	routingKey string
+	ttl        int32
+}{
+	{"retry.5s", 5 * 1000},
+	{"retry.30s", 30 * 1000},
+	{"retry.5m", 5 * 60 * 1000},
+}
+
+var rdb *redis.Client
+
+const voiceProfileCacheTTL = 5 * time.Minute
+
+const ttsProgressExchange = "tts_progress"
+
+var (
+	messagesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tts_messages_processed_total",
+		Help: "Zingers the TTS service has finished processing, by outcome.",
+	}, []string{"result"})
+
+	failuresByClass = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tts_failures_total",
+		Help: "Zinger processing failures, by the stage that failed.",
+	}, []string{"class"})
+
+	ffmpegDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tts_ffmpeg_duration_seconds",
+		Help:    "How long each successful ffmpeg speech conversion took to run.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	zingersQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tts_zingers_queue_depth",
+		Help: "Number of messages currently waiting in the zingers queue.",
+	})
+)
+
+// publishProgress streams a percent-complete update for a long-running
+// ffmpeg invocation to the tts_progress topic exchange, keyed by GuildID, so
+// a bot frontend can render a live progress bar.
+func publishProgress(ch *amqp.Channel, guildID string, percent float64) {
+	body, err := json.Marshal(map[string]interface{}{
+		"guild_id": guildID,
+		"percent":  percent,
+	})
+	if err != nil {
+		return
+	}
+	if err := ch.Publish(ttsProgressExchange, guildID, false, false, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	}); err != nil {
+		log.Printf("Failed to publish TTS progress for guild %s: %v", guildID, err)
+	}
+}
+
+// pollQueueDepth keeps the tts_zingers_queue_depth gauge fresh so /metrics
+// reflects backlog even between message deliveries.
+func pollQueueDepth(ch *amqp.Channel) {
+	for {
+		if queue, err := ch.QueueInspect("zingers"); err == nil {
+			zingersQueueDepth.Set(float64(queue.Messages))
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// hydrateVoiceProfile fetches a guild's voice profile from the database
+// service, caching the result in Redis so a burst of zingers in the same
+// guild doesn't hammer it with one HTTP round trip per message.
+func hydrateVoiceProfile(dbServiceURL, guildID string) (VoiceProfile, error) {
+	cacheKey := "voice_profile:" + guildID
+	ctx := context.Background()
+
+	if cached, err := rdb.Get(ctx, cacheKey).Result(); err == nil {
+		var profile VoiceProfile
+		if err := json.Unmarshal([]byte(cached), &profile); err == nil {
+			return profile, nil
+		}
+	}
+
+	resp, err := http.Get(dbServiceURL + "/guild/" + guildID + "/voice")
+	if err != nil {
+		return VoiceProfile{}, fmt.Errorf("fetch voice profile: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return VoiceProfile{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return VoiceProfile{}, fmt.Errorf("fetch voice profile: unexpected status %d", resp.StatusCode)
+	}
+
+	var profile VoiceProfile
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return VoiceProfile{}, fmt.Errorf("decode voice profile: %v", err)
+	}
+
+	if raw, err := json.Marshal(profile); err == nil {
+		if err := rdb.Set(ctx, cacheKey, raw, voiceProfileCacheTTL).Err(); err != nil {
+			log.Printf("Failed to cache voice profile for guild %s: %v", guildID, err)
+		}
+	}
+
+	return profile, nil
+}
+
+// fetchPartyMembership asks the database service which guilds, if any, are
+// grouped into a watch party with guildID; the returned set includes guildID.
+func fetchPartyMembership(dbServiceURL, guildID string) (PartyMembership, error) {
+	resp, err := http.Get(dbServiceURL + "/party/" + guildID)
+	if err != nil {
+		return PartyMembership{}, fmt.Errorf("fetch party membership: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return PartyMembership{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return PartyMembership{}, fmt.Errorf("fetch party membership: unexpected status %d", resp.StatusCode)
+	}
+
+	var membership PartyMembership
+	if err := json.NewDecoder(resp.Body).Decode(&membership); err != nil {
+		return PartyMembership{}, fmt.Errorf("decode party membership: %v", err)
+	}
+	return membership, nil
+}
+
+// resolveVoiceSettings merges an explicit per-message voice override with
+// the guild's stored profile, falling back to sane defaults when neither is
+// set.
+func resolveVoiceSettings(zingerMsg ZingerMessage, profile VoiceProfile) (language, speed, pitch string) {
+	// Voice is the more specific, intentional selector: if it's set on the
+	// zinger or the guild's profile, it wins over whatever Language holds.
+	lang := zingerMsg.Voice
+	if lang == "" {
+		lang = profile.Voice
+	}
+	if lang == "" {
+		lang = zingerMsg.Language
+	}
+	if lang == "" {
+		lang = profile.Language
+	}
+	if lang == "" {
+		lang = voices.English
+	}
+
+	speedVal := profile.Speed
+	if speedVal == 0 {
+		speedVal = 1.0
+	}
+	pitchVal := profile.Pitch
+	if pitchVal == 0 {
+		pitchVal = 1.0
+	}
+
+	return lang, strconv.FormatFloat(speedVal, 'f', -1, 64), strconv.FormatFloat(pitchVal, 'f', -1, 64)
+}
+
+// deathCount sums the x-death counters on a message so we know how many
+// times it has already cycled through the retry stages.
+func deathCount(headers amqp.Table) int {
+	raw, ok := headers["x-death"]
+	if !ok {
+		return 0
+	}
+	deaths, ok := raw.([]interface{})
+	if !ok {
+		return 0
+	}
+	total := 0
+	for _, d := range deaths {
+		entry, ok := d.(amqp.Table)
+		if !ok {
+			continue
+		}
+		if count, ok := entry["count"].(int64); ok {
+			total += int(count)
+		}
+	}
+	return total
 }
 
 func main() {
@@ -37,6 +279,26 @@ func main() {
 		log.Fatalf("Failed to create audio directory: %v", err)
 	}
 
+	if maxCacheBytes := getEnv("MAX_CACHE_BYTES", ""); maxCacheBytes != "" {
+		limit, err := strconv.ParseInt(maxCacheBytes, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid MAX_CACHE_BYTES %q: %v", maxCacheBytes, err)
+		}
+		go evictOldCacheEntries(audioDir, limit)
+	}
+
+	rdb = redis.NewClient(&redis.Options{
+		Addr: getEnv("REDIS_HOST", "localhost:6379"),
+		DB:   0,
+	})
+	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
+		log.Printf("Redis connection failed: %v", err)
+	} else {
+		log.Println("Connected to Redis")
+	}
+
+	dbServiceURL := getEnv("DB_SERVICE_URL", "http://localhost:8000")
+
 	// Connect to RabbitMQ
 	conn, err := amqp.Dial(rabbitmqURL)
 	if err != nil {
@@ -50,8 +312,14 @@ func main() {
 	}
 	defer ch.Close()
 
+	if err := declareRetryTopology(ch); err != nil {
+		log.Fatalf("Failed to declare dead-letter topology: %v", err)
+	}
+
 	// Declare queues
-	_, err = ch.QueueDeclare("zingers", true, false, false, false, nil)
+	_, err = ch.QueueDeclare("zingers", true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange": zingersDLX,
+	})
 	if err != nil {
 		log.Fatalf("Failed to declare zingers queue: %v", err)
 	}
@@ -61,45 +329,138 @@ func main() {
 		log.Fatalf("Failed to declare audio_queue: %v", err)
 	}
 
+	if err := ch.ExchangeDeclare(audioBroadcastExchange, "fanout", true, false, false, false, nil); err != nil {
+		log.Fatalf("Failed to declare %s exchange: %v", audioBroadcastExchange, err)
+	}
+
+	if err := ch.ExchangeDeclare(ttsProgressExchange, "topic", true, false, false, false, nil); err != nil {
+		log.Fatalf("Failed to declare %s exchange: %v", ttsProgressExchange, err)
+	}
+
+	// serveAdmin and pollQueueDepth each get their own channel, same as the
+	// TTS_WORKERS pool below -- amqp091-go's Channel.call() correlates a
+	// synchronous RPC's reply by being the only caller on that channel, so
+	// sharing one across goroutines (or concurrent admin requests) risks one
+	// caller reading another's reply.
+	adminCh, err := conn.Channel()
+	if err != nil {
+		log.Fatalf("Failed to open admin channel: %v", err)
+	}
+	defer adminCh.Close()
+
+	pollCh, err := conn.Channel()
+	if err != nil {
+		log.Fatalf("Failed to open queue-depth channel: %v", err)
+	}
+	defer pollCh.Close()
+
+	go serveAdmin(getEnv("ADMIN_ADDR", ":8090"), adminCh)
+	go pollQueueDepth(pollCh)
+	go serveMetrics(getEnv("METRICS_ADDR", ":2112"))
+
 	// Consume messages from zingers queue
 	msgs, err := ch.Consume("zingers", "", false, false, false, false, nil)
 	if err != nil {
 		log.Fatalf("Failed to register consumer: %v", err)
 	}
 
-	log.Println("TTS Service started. Waiting for messages...")
+	workerCount := getEnvInt("TTS_WORKERS", 4)
+	log.Printf("TTS Service started with %d workers. Waiting for messages...", workerCount)
 
-	for msg := range msgs {
-		log.Printf("Received message: %s", msg.Body)
-
-		var zingerMsg ZingerMessage
-		if err := json.Unmarshal(msg.Body, &zingerMsg); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
-			msg.Nack(false, false)
-			continue
+	var workers sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		workerCh, err := conn.Channel()
+		if err != nil {
+			log.Fatalf("Failed to open worker channel: %v", err)
 		}
 
-		// Generate TTS file
-		filename := fmt.Sprintf("tts_%d", time.Now().Unix())
+		workers.Add(1)
+		go func(workerCh *amqp.Channel) {
+			defer workers.Done()
+			defer workerCh.Close()
+			for msg := range msgs {
+				processZinger(workerCh, msg, audioDir, dbServiceURL)
+			}
+		}(workerCh)
+	}
+	workers.Wait()
+}
+
+// processZinger carries a single zinger all the way from raw delivery to a
+// published AudioMessage (on audio_queue, or for partied guilds as a
+// watch-party broadcast instead).
+// It's the unit of work handed to each of the TTS_WORKERS pool goroutines.
+func processZinger(ch *amqp.Channel, msg amqp.Delivery, audioDir, dbServiceURL string) {
+	log.Printf("Received message: %s", msg.Body)
+
+	var zingerMsg ZingerMessage
+	if err := json.Unmarshal(msg.Body, &zingerMsg); err != nil {
+		// Bad JSON will never parse no matter how many times we retry it.
+		failuresByClass.WithLabelValues("unmarshal").Inc()
+		messagesProcessed.WithLabelValues("failure").Inc()
+		routeFailedMessage(ch, msg, fmt.Errorf("unmarshal message: %v", err), false)
+		return
+	}
+
+	profile, err := hydrateVoiceProfile(dbServiceURL, zingerMsg.GuildID)
+	if err != nil {
+		log.Printf("Failed to hydrate voice profile for guild %s, falling back to defaults: %v", zingerMsg.GuildID, err)
+	}
+	language, speed, pitch := resolveVoiceSettings(zingerMsg, profile)
 
-		opus_path, err := generateTTS(zingerMsg.Text, filename, audioDir)
+	// Identical zingers (very common for a canned insult bot) share a cache
+	// entry keyed by their content, so repeats skip htgotts + ffmpeg entirely.
+	hash := cacheKey(language, speed+"/"+pitch, fmt.Sprintf("%v|%s", zingerMsg.SSML, zingerMsg.Text))
+	cachedPath := filepath.Join(audioDir, hash+".opus")
+
+	opus_path := cachedPath
+	if !fileExists(cachedPath) {
+		filename := fmt.Sprintf("tts_%d", time.Now().Unix())
+		generatedPath, err := generateTTS(ch, zingerMsg.GuildID, zingerMsg.Text, filename, audioDir, language, speed, pitch, zingerMsg.SSML)
 		if err != nil {
-			log.Printf("Failed to generate TTS: %v", err)
-			msg.Nack(false, false)
-			continue
+			// htgotts/ffmpeg failures are almost always transient (disk hiccup,
+			// ffmpeg crash) so give them a few backed-off attempts.
+			failuresByClass.WithLabelValues("generate_tts").Inc()
+			messagesProcessed.WithLabelValues("failure").Inc()
+			routeFailedMessage(ch, msg, fmt.Errorf("generate TTS: %v", err), true)
+			return
 		}
 
-		audioMsg := AudioMessage{
-			Filename: filename,
-			Path:     opus_path,
-			GuildID:  zingerMsg.GuildID,
+		if err := os.Rename(generatedPath, cachedPath); err != nil && !os.IsExist(err) {
+			failuresByClass.WithLabelValues("cache").Inc()
+			messagesProcessed.WithLabelValues("failure").Inc()
+			routeFailedMessage(ch, msg, fmt.Errorf("place %s in cache as %s: %v", generatedPath, cachedPath, err), true)
+			return
 		}
+	} else {
+		log.Printf("Cache hit for zinger, reusing %s", cachedPath)
+	}
+	touchCacheEntry(cachedPath)
+
+	audioMsg := AudioMessage{
+		Filename: hash,
+		Path:     opus_path,
+		GuildID:  zingerMsg.GuildID,
+	}
+
+	membership, membershipErr := fetchPartyMembership(dbServiceURL, zingerMsg.GuildID)
+	if membershipErr != nil {
+		log.Printf("Failed to look up party membership for guild %s, skipping broadcast: %v", zingerMsg.GuildID, membershipErr)
+	}
+	inParty := membershipErr == nil && len(membership.GuildIDs) > 0
 
+	// get_party's membership set already includes the originating guild, so
+	// when it's partied we route it through the broadcast below instead of
+	// also publishing the normal audio_queue message -- otherwise it would
+	// double-play and always land ~partyPlaybackDelay ahead of the rest of
+	// its own party.
+	if !inParty {
 		audioMsgJSON, err := json.Marshal(audioMsg)
 		if err != nil {
-			log.Printf("Failed to marshal audio message: %v", err)
-			msg.Nack(false, false)
-			continue
+			failuresByClass.WithLabelValues("marshal").Inc()
+			messagesProcessed.WithLabelValues("failure").Inc()
+			routeFailedMessage(ch, msg, fmt.Errorf("marshal audio message: %v", err), false)
+			return
 		}
 
 		err = ch.Publish("", "audio_queue", false, false, amqp.Publishing{
@@ -108,22 +469,211 @@ func main() {
 		})
 
 		if err != nil {
-			log.Printf("Failed to publish audio message: %v", err)
-			msg.Nack(false, false)
-			continue
+			// A broker hiccup publishing to audio_queue is worth retrying.
+			failuresByClass.WithLabelValues("publish").Inc()
+			messagesProcessed.WithLabelValues("failure").Inc()
+			routeFailedMessage(ch, msg, fmt.Errorf("publish audio message: %v", err), true)
+			return
 		}
+	}
 
-		log.Printf("Generated TTS file: %s", opus_path)
-		msg.Ack(false)
+	if inParty {
+		playAt := time.Now().Add(partyPlaybackDelay)
+		for _, targetGuildID := range membership.GuildIDs {
+			broadcastMsg := audioMsg
+			broadcastMsg.GuildID = targetGuildID
+			broadcastMsg.PlayAt = playAt
+			broadcastMsgJSON, err := json.Marshal(broadcastMsg)
+			if err != nil {
+				log.Printf("Failed to marshal party broadcast message for guild %s: %v", targetGuildID, err)
+				continue
+			}
+			// audio.broadcast is a fanout exchange, so every playback worker
+			// receives every guild's message and must filter on GuildID itself.
+			if err := ch.Publish(audioBroadcastExchange, "", false, false, amqp.Publishing{
+				ContentType: "application/json",
+				Body:        broadcastMsgJSON,
+			}); err != nil {
+				log.Printf("Failed to publish party broadcast for guild %s: %v", targetGuildID, err)
+			}
+		}
+		log.Printf("Broadcast zinger to party %s (%d guilds), playing at %s", membership.PartyID, len(membership.GuildIDs), playAt)
 	}
 
+	log.Printf("Generated TTS file: %s", opus_path)
+	messagesProcessed.WithLabelValues("success").Inc()
+	msg.Ack(false)
 }
 
-func generateTTS(text, filename string, audioDir string) (string, error) {
+// serveMetrics exposes the Prometheus registry so an operator can scrape
+// message throughput, failure classes, ffmpeg latency, and queue depth.
+func serveMetrics(addr string) {
+	log.Printf("TTS metrics listening on %s", addr)
+	if err := http.ListenAndServe(addr, promhttp.Handler()); err != nil {
+		log.Printf("Metrics HTTP server stopped: %v", err)
+	}
+}
+
+// declareRetryTopology sets up the zingers.dlx exchange, the escalating
+// retry queues bound to it, and the terminal zingers.dead queue.
+func declareRetryTopology(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(zingersDLX, "direct", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare %s exchange: %v", zingersDLX, err)
+	}
+
+	for _, stage := range retryStages {
+		queueName := "zingers." + stage.routingKey
+		_, err := ch.QueueDeclare(queueName, true, false, false, false, amqp.Table{
+			"x-message-ttl":             stage.ttl,
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": "zingers",
+		})
+		if err != nil {
+			return fmt.Errorf("declare %s: %v", queueName, err)
+		}
+		if err := ch.QueueBind(queueName, stage.routingKey, zingersDLX, false, nil); err != nil {
+			return fmt.Errorf("bind %s: %v", queueName, err)
+		}
+	}
 
+	if _, err := ch.QueueDeclare(zingersDead, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare %s: %v", zingersDead, err)
+	}
+	if err := ch.QueueBind(zingersDead, "dead", zingersDLX, false, nil); err != nil {
+		return fmt.Errorf("bind %s: %v", zingersDead, err)
+	}
+
+	return nil
+}
+
+// routeFailedMessage decides, based on whether the failure is transient and
+// how many times the message has already been retried, whether to push it
+// into the next backoff stage or give up on it permanently. It always acks
+// the original delivery since the re-publish takes over ownership of it.
+func routeFailedMessage(ch *amqp.Channel, msg amqp.Delivery, cause error, transient bool) {
+	headers := msg.Headers
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	headers[retryReasonHdr] = cause.Error()
+
+	routingKey := "dead"
+	if transient {
+		attempt := deathCount(msg.Headers)
+		if attempt < len(retryStages) {
+			routingKey = retryStages[attempt].routingKey
+			log.Printf("Retrying zinger after %v (attempt %d), backing off via %s", cause, attempt+1, routingKey)
+		} else {
+			log.Printf("Zinger exhausted %d retries (%v), moving to %s", maxRetries, cause, zingersDead)
+		}
+	} else {
+		log.Printf("Permanent failure (%v), moving straight to %s", cause, zingersDead)
+	}
+
+	err := ch.Publish(zingersDLX, routingKey, false, false, amqp.Publishing{
+		ContentType: msg.ContentType,
+		Headers:     headers,
+		Body:        msg.Body,
+	})
+	if err != nil {
+		log.Printf("Failed to route failed zinger to %s, dropping: %v", routingKey, err)
+	}
+
+	msg.Ack(false)
+}
+
+// ssmlSegment is one piece of a minimally-parsed SSML document: either text
+// to synthesize (with an optional <prosody rate="..."> override) or a pause.
+type ssmlSegment struct {
+	text    string
+	rate    string
+	breakMs int
+}
+
+var ssmlTagPattern = regexp.MustCompile(`<break time="(\d+)ms"\s*/>|<prosody rate="([^"]*)">(.*?)</prosody>`)
+
+// parseSSML understands just enough SSML for canned insults: <break
+// time="500ms"/> pauses and <prosody rate="...">...</prosody> rate changes.
+// Anything outside those tags is treated as plain text at the default rate.
+func parseSSML(text string) []ssmlSegment {
+	var segments []ssmlSegment
+	last := 0
+	for _, match := range ssmlTagPattern.FindAllStringSubmatchIndex(text, -1) {
+		if plain := strings.TrimSpace(text[last:match[0]]); plain != "" {
+			segments = append(segments, ssmlSegment{text: plain})
+		}
+		if match[2] != -1 {
+			ms, _ := strconv.Atoi(text[match[2]:match[3]])
+			segments = append(segments, ssmlSegment{breakMs: ms})
+		} else {
+			segments = append(segments, ssmlSegment{
+				rate: text[match[4]:match[5]],
+				text: strings.TrimSpace(text[match[6]:match[7]]),
+			})
+		}
+		last = match[1]
+	}
+	if plain := strings.TrimSpace(text[last:]); plain != "" {
+		segments = append(segments, ssmlSegment{text: plain})
+	}
+	return segments
+}
+
+// generateTTS synthesizes text into an opus file at the requested language,
+// speed and pitch. When ssml is set it splits the text on <break> and
+// <prosody> tags, synthesizes each segment (and any silences) separately,
+// and stitches them back together with ffmpeg's concat demuxer.
+func generateTTS(ch *amqp.Channel, guildID, text, filename, audioDir, language, speed, pitch string, ssml bool) (string, error) {
+	opus_path := filepath.Join(audioDir, filename+".opus")
+
+	if !ssml {
+		return synthesizeSegment(ch, guildID, text, filename, audioDir, language, speed, pitch)
+	}
+
+	segments := parseSSML(text)
+	var partPaths []string
+	defer func() {
+		for _, p := range partPaths {
+			os.Remove(p)
+		}
+	}()
+
+	for i, seg := range segments {
+		partName := fmt.Sprintf("%s_part%d", filename, i)
+		if seg.breakMs > 0 {
+			partPath, err := generateSilence(partName, audioDir, seg.breakMs)
+			if err != nil {
+				return "", fmt.Errorf("failed to generate SSML pause: %v", err)
+			}
+			partPaths = append(partPaths, partPath)
+			continue
+		}
+
+		partRate := speed
+		if seg.rate != "" {
+			partRate = seg.rate
+		}
+		partPath, err := synthesizeSegment(ch, guildID, seg.text, partName, audioDir, language, partRate, pitch)
+		if err != nil {
+			return "", fmt.Errorf("failed to synthesize SSML segment %d: %v", i, err)
+		}
+		partPaths = append(partPaths, partPath)
+	}
+
+	if err := concatSegments(partPaths, opus_path, audioDir, filename); err != nil {
+		return "", fmt.Errorf("failed to concatenate SSML segments: %v", err)
+	}
+
+	return opus_path, nil
+}
+
+// synthesizeSegment runs a single htgotts + ffmpeg pass, applying the
+// atempo/asetrate filters that implement the speed/pitch knobs and
+// streaming percent-complete updates for the caller's guild.
+func synthesizeSegment(ch *amqp.Channel, guildID, text, filename, audioDir, language, speed, pitch string) (string, error) {
 	speech := htgotts.Speech{
 		Folder:   audioDir,
-		Language: voices.English,
+		Language: language,
 		Handler:  &handlers.Native{},
 	}
 
@@ -134,21 +684,306 @@ func generateTTS(text, filename string, audioDir string) (string, error) {
 
 	opus_path := filepath.Join(audioDir, filename+".opus")
 
-	convertCmd := exec.Command("ffmpeg", "-i", path, "-c:a", "libopus", opus_path)
-	if err := convertCmd.Run(); err != nil {
+	args := []string{"-progress", "pipe:1", "-i", path}
+	if filter := speedPitchFilter(speed, pitch); filter != "" {
+		args = append(args, "-af", filter)
+	}
+	args = append(args, "-c:a", "libopus", opus_path)
+
+	sourceDuration, err := ffprobeDuration(path)
+	if err != nil {
+		log.Printf("Failed to probe duration of %s, progress updates disabled: %v", path, err)
+	}
+
+	convertCmd := exec.Command("ffmpeg", args...)
+	start := time.Now()
+	if err := runWithProgress(convertCmd, ch, guildID, sourceDuration); err != nil {
 		os.Remove(opus_path)
 		os.Remove(path)
 		return "", fmt.Errorf("failed to convert audio: %v", err)
 	}
+	ffmpegDuration.Observe(time.Since(start).Seconds())
 
 	os.Remove(path)
 
 	return opus_path, nil
 }
 
+// ffprobeDuration reports the duration, in seconds, of the audio at path, so
+// runWithProgress can turn ffmpeg's out_time_ms= progress lines into a
+// percent-complete figure.
+func ffprobeDuration(path string) (float64, error) {
+	out, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+}
+
+// runWithProgress runs an ffmpeg command configured with "-progress pipe:1"
+// and publishes a percent-complete update to tts_progress for every
+// out_time_ms= line it reports, so long inputs can show a live progress bar.
+func runWithProgress(cmd *exec.Cmd, ch *amqp.Channel, guildID string, totalDurationSeconds float64) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "out_time_ms=") {
+			continue
+		}
+		if totalDurationSeconds <= 0 {
+			continue
+		}
+		outTimeMs, err := strconv.ParseFloat(strings.TrimPrefix(line, "out_time_ms="), 64)
+		if err != nil {
+			continue
+		}
+		percent := (outTimeMs / 1_000_000) / totalDurationSeconds * 100
+		if percent > 100 {
+			percent = 100
+		}
+		publishProgress(ch, guildID, percent)
+	}
+
+	return cmd.Wait()
+}
+
+// speedPitchFilter builds an ffmpeg audio filter chain from the guild's
+// speed/pitch settings: atempo changes playback rate without affecting
+// pitch, asetrate changes both (a cheap way to raise/lower pitch).
+func speedPitchFilter(speed, pitch string) string {
+	var filters []string
+	if speed != "" && speed != "1" {
+		filters = append(filters, "atempo="+speed)
+	}
+	if pitch != "" && pitch != "1" {
+		filters = append(filters, "asetrate=44100*"+pitch+",aresample=44100")
+	}
+	return strings.Join(filters, ",")
+}
+
+// generateSilence produces an SSML <break> as its own opus segment so it
+// can be spliced in alongside synthesized speech by concatSegments.
+func generateSilence(filename, audioDir string, ms int) (string, error) {
+	opus_path := filepath.Join(audioDir, filename+".opus")
+	duration := fmt.Sprintf("%.3f", float64(ms)/1000)
+
+	cmd := exec.Command("ffmpeg", "-f", "lavfi", "-i", "anullsrc=r=44100:cl=mono", "-t", duration, "-c:a", "libopus", opus_path)
+	if err := cmd.Run(); err != nil {
+		os.Remove(opus_path)
+		return "", fmt.Errorf("failed to generate silence: %v", err)
+	}
+
+	return opus_path, nil
+}
+
+// concatSegments stitches the per-segment opus files back into one file
+// using ffmpeg's concat demuxer.
+func concatSegments(partPaths []string, outPath, audioDir, filename string) error {
+	if len(partPaths) == 1 {
+		return os.Rename(partPaths[0], outPath)
+	}
+
+	listPath := filepath.Join(audioDir, filename+"_concat.txt")
+	var list bytes.Buffer
+	for _, p := range partPaths {
+		fmt.Fprintf(&list, "file '%s'\n", p)
+	}
+	if err := os.WriteFile(listPath, list.Bytes(), 0644); err != nil {
+		return fmt.Errorf("write concat list: %v", err)
+	}
+	defer os.Remove(listPath)
+
+	cmd := exec.Command("ffmpeg", "-f", "concat", "-safe", "0", "-i", listPath, "-c", "copy", outPath)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg concat: %v", err)
+	}
+
+	return nil
+}
+
+// cacheKey derives the content-addressed cache filename for a given
+// language|voice|text combination so identical zingers reuse one opus file.
+func cacheKey(language, voice, text string) string {
+	sum := sha256.Sum256([]byte(language + "|" + voice + "|" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// touchCacheEntry bumps the file's mtime so evictOldCacheEntries treats it
+// as recently accessed, keeping frequently repeated zingers in the cache.
+func touchCacheEntry(path string) {
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		log.Printf("Failed to touch cache entry %s: %v", path, err)
+	}
+}
+
+// evictOldCacheEntries periodically walks audioDir and removes the
+// least-recently-accessed opus files until the directory is back under
+// maxBytes, bounding how much disk the TTS cache can consume.
+func evictOldCacheEntries(audioDir string, maxBytes int64) {
+	for {
+		entries, err := os.ReadDir(audioDir)
+		if err != nil {
+			log.Printf("Cache eviction: failed to read %s: %v", audioDir, err)
+			time.Sleep(time.Minute)
+			continue
+		}
+
+		type cacheFile struct {
+			path    string
+			size    int64
+			modTime time.Time
+		}
+		var files []cacheFile
+		var total int64
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".opus" {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			files = append(files, cacheFile{
+				path:    filepath.Join(audioDir, entry.Name()),
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			})
+			total += info.Size()
+		}
+
+		if total > maxBytes {
+			sort.Slice(files, func(i, j int) bool {
+				return files[i].modTime.Before(files[j].modTime)
+			})
+			for _, f := range files {
+				if total <= maxBytes {
+					break
+				}
+				if err := os.Remove(f.path); err != nil {
+					log.Printf("Cache eviction: failed to remove %s: %v", f.path, err)
+					continue
+				}
+				total -= f.size
+				log.Printf("Cache eviction: removed %s to stay under MAX_CACHE_BYTES", f.path)
+			}
+		}
+
+		time.Sleep(time.Minute)
+	}
+}
+
+// deadMessageView is the JSON shape returned by the admin dead-letter
+// inspection endpoint.
+type deadMessageView struct {
+	Body   string `json:"body"`
+	Reason string `json:"reason"`
+}
+
+// serveAdmin exposes a tiny HTTP admin surface for inspecting and replaying
+// messages that landed in zingers.dead after exhausting their retries.
+func serveAdmin(addr string, ch *amqp.Channel) {
+	// Both handlers below issue synchronous RPCs (QueueInspect/Get/Publish)
+	// on the same channel, so a request to one can't be allowed to overlap
+	// with a request to the other -- see the channel-sharing note in main().
+	var mu sync.Mutex
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/dead", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		queue, err := ch.QueueInspect(zingersDead)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		messages := []deadMessageView{}
+		var peeked []amqp.Delivery
+		for i := 0; i < queue.Messages; i++ {
+			delivery, ok, err := ch.Get(zingersDead, false)
+			if err != nil || !ok {
+				break
+			}
+			messages = append(messages, deadMessageView{
+				Body:   string(delivery.Body),
+				Reason: fmt.Sprintf("%v", delivery.Headers[retryReasonHdr]),
+			})
+			peeked = append(peeked, delivery)
+		}
+		// Put them back, we're only peeking. Requeuing inside the loop would
+		// return each message to the head of the queue and fetch it again.
+		for _, delivery := range peeked {
+			delivery.Nack(false, true)
+		}
+
+		json.NewEncoder(w).Encode(messages)
+	})
+
+	mux.HandleFunc("POST /admin/dead/replay", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		replayed := 0
+		for {
+			delivery, ok, err := ch.Get(zingersDead, false)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				break
+			}
+			if err := ch.Publish("", "zingers", false, false, amqp.Publishing{
+				ContentType: delivery.ContentType,
+				Body:        delivery.Body,
+			}); err != nil {
+				delivery.Nack(false, true)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			delivery.Ack(false)
+			replayed++
+		}
+		json.NewEncoder(w).Encode(map[string]int{"replayed": replayed})
+	})
+
+	log.Printf("TTS admin endpoint listening on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Admin HTTP server stopped: %v", err)
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, value, err)
+	}
+	return parsed
+}